@@ -9,6 +9,7 @@ import (
 	"encoding/base64"
 	"encoding/json"
 	"errors"
+	"golang.org/x/oauth2"
 	"golang.org/x/sys/unix"
 	"golang.zx2c4.com/wireguard/wgctrl/wgtypes"
 	"io"
@@ -16,8 +17,10 @@ import (
 	"math/rand"
 	"net"
 	"net/http"
+	"net/url"
 	"os"
 	"strings"
+	"sync"
 	"syscall"
 	"time"
 )
@@ -29,6 +32,14 @@ var ErrHttpStatusBad = errors.New( "bad HTTP status" )
 var ErrBadPin = errors.New( "bad public key PIN" )
 var ErrMissingHost = errors.New( "missing host" )
 var ErrBadDomain = errors.New( "bad domain ")
+var ErrBadDnsServer = errors.New( "bad DNS server URL" )
+
+// dnsResolver is satisfied by both *net.Resolver and *secureResolver, letting Resolve() and future components share whichever one Init() wired up
+type dnsResolver interface {
+	LookupIPAddr( ctx context.Context, host string ) ( []net.IPAddr, error )
+}
+
+const unixSocketPrefix = "unix://"														// Host prefix which selects the unix domain socket transport
 
 type Config struct {
 	APIVersion				string			`yaml:"-"`										// Current API version is 1.0.0
@@ -46,32 +57,74 @@ type Config struct {
 	Mark					int				`yaml:"mark,omitempty"`							// Firewall mark for the traffic generated by this app
 	DnsServers				string			`yaml:"dnsServers,omitempty"`					// DNS servers to use when resolving names for client requests ( wireguard link uses it's assigned DNS servers )
 	Filter					Filter			`yaml:"filter,omitempty"`						// Filtering settings
+	OIDC					OIDCConfig		`yaml:"oidc,omitempty"`							// OIDC device-code login, used instead of Username/Password when Issuer is set
+	PinsPath				string			`yaml:"pinsPath,omitempty"`						// Path to a signed pin manifest, unioned with the built-in pins ( rotatable without a binary upgrade )
+	PinTofu					bool			`yaml:"pinTofu,omitempty"`						// Trust-On-First-Use: record the first observed CA pin per name instead of hard-failing on an unknown one
 }
 
 // SetHost adds .hideservers.net suffix for short names ( nl becomes nl.hideservers.net ) or removes .hide.me and replaces it with .hideservers.net.
 func ( c *Config ) SetHost( host string ) {
 	c.Host = host
+	if strings.HasPrefix( c.Host, unixSocketPrefix ) { return }											// Unix domain socket paths are used verbatim, no DNS involved
 	if net.ParseIP( c.Host ) != nil { return }
 	if strings.HasSuffix( c.Host, ".hideservers.net" ) { return }
 	c.Host = strings.TrimSuffix( c.Host, ".hide.me" )
 	c.Host += ".hideservers.net"
 }
 
+// IsUnixSocket reports whether Host is a "unix://" path rather than a hostname or IP
+func ( c *Config ) IsUnixSocket() bool { return strings.HasPrefix( c.Host, unixSocketPrefix ) }
+
 type Client struct {
 	*Config
 	
 	client					*http.Client
 	resolver				*net.Resolver
+	secureResolver			*secureResolver
 	dnsServers				[]string
 	remote					*net.TCPAddr
 	
 	accessToken				[]byte
-	authorizedPins			map[string]string
+	pinStoreMu				sync.RWMutex
+	pinStore				*PinStore												// Guarded by pinStoreMu: Pins() reads it off live TLS handshakes while RefreshPins() may swap it from a timer
+	oauthConfig				*oauth2.Config
+	oauthToken				*oauth2.Token
 }
 
+// currentPinStore returns the pin store Pins() should check against right now
+func ( c *Client ) currentPinStore() *PinStore { c.pinStoreMu.RLock(); defer c.pinStoreMu.RUnlock(); return c.pinStore }
+
+// setPinStore atomically swaps the pin store, used by Init() and RefreshPins()
+func ( c *Client ) setPinStore( store *PinStore ) { c.pinStoreMu.Lock(); c.pinStore = store; c.pinStoreMu.Unlock() }
+
 func New( config *Config ) *Client { if config == nil { config = &Config{} }; return &Client{ Config: config } }
 
+// loadAccessToken decodes c.accessToken from Config.AccessToken, falling back to Config.AccessTokenPath, and mirrors
+// it into Config.Filter.AccessToken. Shared by every transport Init() sets up, unix socket included
+func ( c *Client ) loadAccessToken() ( err error ) {
+	if len( c.Config.AccessToken ) > 0 {																											// Access-Token
+		if c.accessToken, err = base64.StdEncoding.DecodeString( c.Config.AccessToken ); err != nil { return }
+	}
+	if c.accessToken == nil && len( c.Config.AccessTokenPath ) > 0 {
+		if accessTokenBytes, readErr := os.ReadFile( c.Config.AccessTokenPath ); readErr == nil {
+			if c.accessToken, err = base64.StdEncoding.DecodeString( string( accessTokenBytes ) ); err != nil { return }
+		}
+	}
+	c.Config.Filter.AccessToken = c.accessToken
+	return
+}
+
 func ( c *Client ) Init() ( err error ) {
+	if c.Config.IsUnixSocket() {																														// Dial a local unix domain socket, bypassing DNS and TLS entirely
+		socketPath := strings.TrimPrefix( c.Config.Host, unixSocketPrefix )
+		transport := &http.Transport{
+			DialContext:		func( ctx context.Context, _, _ string ) ( net.Conn, error ) { return ( &net.Dialer{} ).DialContext( ctx, "unix", socketPath ) },
+			DisableKeepAlives:	true,
+		}
+		c.client = &http.Client{ Transport: transport, Timeout: c.Config.RestTimeout }
+		if err = c.loadAccessToken(); err != nil { return }
+		return
+	}
 	if c.Config.Port == 0 { c.Config.Port = 432 }
 	if c.Port == 443 { c.APIVersion = "v1"; log.Println( "Init: [WARNING] Using port 443, API unstable" ) }
 	if c.Domain != "hide.me" { err = ErrBadDomain; return }
@@ -115,47 +168,63 @@ func ( c *Client ) Init() ( err error ) {
 		Timeout:	c.Config.RestTimeout,
 	}
 	
+	var secureServers []*url.URL																														// DoT/DoH entries parsed out of DnsServers, dispatched through secureResolver instead of plain UDP/TCP
 	if len( c.Config.DnsServers ) > 0 {																												// DNS setup
 		for _, dnsServer := range strings.Split( c.Config.DnsServers, "," ) {
-			c.dnsServers = append( c.dnsServers, strings.TrimSpace( dnsServer ) )
-		}
-	} else { c.dnsServers = append( c.dnsServers, "1.1.1.1:53" ) }
-	
-	if len( c.Config.AccessToken ) > 0 {																											// Access-Token
-		if c.accessToken, err = base64.StdEncoding.DecodeString( c.Config.AccessToken ); err != nil { return }
-	}
-	if c.accessToken == nil && len( c.Config.AccessTokenPath ) > 0 {
-		if accessTokenBytes, err := os.ReadFile( c.Config.AccessTokenPath ); err == nil {
-			if c.accessToken, err = base64.StdEncoding.DecodeString( string( accessTokenBytes ) ); err != nil { return err }
+			dnsServer = strings.TrimSpace( dnsServer )
+			if !strings.Contains( dnsServer, "://" ) { c.dnsServers = append( c.dnsServers, dnsServer ); continue }									// Bare host:port, plain UDP ( default, backwards compatible )
+			parsed, parseErr := url.Parse( dnsServer )
+			if parseErr != nil { return ErrBadDnsServer }
+			switch parsed.Scheme {
+				case "udp", "tcp": c.dnsServers = append( c.dnsServers, parsed.Host )
+				case "tls", "https": secureServers = append( secureServers, parsed )
+				default: return ErrBadDnsServer
+			}
 		}
 	}
-	c.Config.Filter.AccessToken = c.accessToken
+	if len( c.dnsServers ) == 0 && len( secureServers ) == 0 { c.dnsServers = append( c.dnsServers, "1.1.1.1:53" ) }
+	if len( secureServers ) > 0 { c.secureResolver = newSecureResolver( c, secureServers, dialer ) }												// DoT/DoH resolver takes over from Resolve() onward, plain resolver stays wired into the HTTPS dialer above
 	
-	c.authorizedPins = map[string]string{																											// Certificate names and pins
-		"Hide.Me Root CA": "AdKh8rXi68jeqv5kEzF4wJ9M2R89gFuMILRQ1uwADQI=",
-		"Hide.Me Server CA #1": "CsEyDelMHMPh9qLGgeQn8sJwdUwvc+fCMhOU9Ne5PbU=",
-		"DigiCert Global Root CA": "r/mIkG3eEpVdm+u/ko/cwxzOMo1bk4TyHIlByibiA5E=",
-		"DigiCert TLS RSA SHA256 2020 CA1": "RQeZkB42znUfsDIIFWIRiYEcKl7nHwNFwWCrnMMJbVc=",
-	}
+	if err = c.loadAccessToken(); err != nil { return }
+
+	c.setPinStore( newPinStore( defaultPins, c.Config.PinsPath, c.Config.PinTofu ) )																	// Built-in pins, unioned with a signed manifest from PinsPath when one is present ( never fails Init, see newPinStore )
 	return
 }
 
 func ( c *Client ) Remote() *net.TCPAddr { return c.remote }
 
-// Pins checks public key pins of authorized hide.me/hideservers.net CA certificates
+// Resolver returns the resolver Resolve() uses, a DoT/DoH secureResolver when Config.DnsServers configured one, otherwise the plain resolver dialing dnsServers over UDP/TCP
+func ( c *Client ) Resolver() dnsResolver { if c.secureResolver != nil { return c.secureResolver }; return c.resolver }
+
+// baseURL returns the scheme+host portion REST requests are issued against, a fixed "unix" authority when dialing a local socket
+func ( c *Client ) baseURL() string { if c.Config.IsUnixSocket() { return "http://unix" }; return "https://" + c.remote.String() }
+
+// Pins checks public key pins of authorized hide.me/hideservers.net CA certificates against c.pinStore, falling back
+// to TOFU ( record-on-first-use, log loudly on mismatch instead of failing ) when Config.PinTofu is set
 func ( c *Client ) Pins( _ [][]byte, verifiedChains [][]*x509.Certificate) error {
+	store := c.currentPinStore()
 	for _, chain := range verifiedChains {
 		chainLoop:
 		for _, certificate := range chain {
 			if !certificate.IsCA { continue }
 			sum := sha256.Sum256( certificate.RawSubjectPublicKeyInfo )
 			pin := base64.StdEncoding.EncodeToString( sum[:] )
-			for name, authorizedPin := range c.authorizedPins {
+			for name, authorizedPin := range store.pins {
 				if certificate.Subject.CommonName == name && pin == authorizedPin {
 					log.Println( "Pins:", certificate.Subject.CommonName, "pin OK" )
 					continue chainLoop
 				}
 			}
+			if c.Config.PinTofu {
+				if tofuPin, recorded := store.tofuLookup( certificate.Subject.CommonName ); recorded {
+					if tofuPin == pin { log.Println( "Pins:", certificate.Subject.CommonName, "TOFU pin OK" ); continue chainLoop }
+					log.Println( "Pins: [WARNING]", certificate.Subject.CommonName, "TOFU pin mismatch, was the CA rotated? Not failing closed" )
+					continue chainLoop
+				}
+				if err := store.recordTofu( certificate.Subject.CommonName, pin ); err != nil { log.Println( "Pins: [ERR] Failed to record TOFU pin:", err ) }
+				log.Println( "Pins: [WARNING]", certificate.Subject.CommonName, "pin recorded via TOFU:", pin )
+				continue chainLoop
+			}
 			log.Println( "Pins:", certificate.Subject.CommonName, "pin failed" )
 			return ErrBadPin
 		}
@@ -194,8 +263,9 @@ func ( c *Client ) HaveAccessToken() bool { if c.accessToken != nil { return tru
 // Resolve resolves an IP of a Hide.me endpoint and stores that IP for further use. Hide.me balances DNS rapidly, so once an IP is acquired it needs to be used for the remainder of the session
 func ( c *Client ) Resolve( ctx context.Context ) ( err error ) {
 	if len( c.Host ) == 0 { err = ErrMissingHost; return }
+	if c.Config.IsUnixSocket() { return }																												// Nothing to resolve, requests are dialed straight at the socket
 	if ip := net.ParseIP( c.Config.Host ); ip != nil { c.remote = &net.TCPAddr{ IP: ip, Port: c.Config.Port }; return }								// c.Host is an IP address, set remote endpoint to that IP
-	addrs, err := c.resolver.LookupIPAddr( ctx, c.Config.Host )
+	addrs, err := c.Resolver().LookupIPAddr( ctx, c.Config.Host )
 	if err != nil {																																	// If DNS fails during reconnect then the remote server address in c.remote will be reused for the reconnection attempt
 		log.Println( "Name: [ERR]", c.Config.Host, "lookup failed:", err )
 		if c.remote != nil { log.Println( "Name: Using previous lookup response", c.remote.String() ); return nil }
@@ -219,7 +289,7 @@ func ( c *Client ) Connect( ctx context.Context, key wgtypes.Key ) ( connectResp
 	}
 	if err = connectRequest.Check(); err != nil { return }
 	
-	responseBody, err := c.postJson( ctx, "https://" + c.remote.String() + "/" + c.Config.APIVersion + "/connect", connectRequest )
+	responseBody, err := c.postJson( ctx, c.baseURL() + "/" + c.Config.APIVersion + "/connect", connectRequest )
 	if err != nil { return }
 	
 	connectResponse = &ConnectResponse{}
@@ -237,28 +307,32 @@ func ( c *Client ) Disconnect( ctx context.Context, sessionToken []byte ) ( err
 	}
 	if err = disconnectRequest.Check(); err != nil { return }
 	
-	_, err = c.postJson( ctx, "https://" + c.remote.String() + "/" + c.Config.APIVersion + "/disconnect", disconnectRequest )
+	_, err = c.postJson( ctx, c.baseURL() + "/" + c.Config.APIVersion + "/disconnect", disconnectRequest )
 	return
 }
 
 // GetAccessToken issues an AccessToken request to a Hide.me "AccessToken" endpoint which expects an ordinary POST request with a AccessTokenRequest JSON payload
 func ( c *Client ) GetAccessToken( ctx context.Context ) ( accessToken string, err error ) {
 	if len( c.Host ) == 0 { err = ErrMissingHost; return }
-	accessTokenRequest := &AccessTokenRequest{
-		Host:			strings.TrimSuffix( c.Config.Host, ".hideservers.net" ),
-		Domain:			c.Config.Domain,
-		AccessToken:	c.accessToken,
-		Username:		c.Config.Username,
-		Password:		c.Config.Password,
+
+	if c.Config.OIDC.Issuer != "" {																												// OIDC device-code login takes precedence over username/password when configured
+		if accessToken, err = c.oidcAccessToken( ctx ); err != nil { return }
+	} else {
+		accessTokenRequest := &AccessTokenRequest{
+			Host:			strings.TrimSuffix( c.Config.Host, ".hideservers.net" ),
+			Domain:			c.Config.Domain,
+			AccessToken:	c.accessToken,
+			Username:		c.Config.Username,
+			Password:		c.Config.Password,
+		}
+		if err = accessTokenRequest.Check(); err != nil { return }
+
+		accessTokenJson, err := c.postJson( ctx, c.baseURL() + "/" + c.Config.APIVersion + "/accessToken", accessTokenRequest )
+		if err != nil { return accessToken, err }
+		if err = json.Unmarshal( accessTokenJson, &accessToken ); err != nil { return accessToken, err }
 	}
-	if err = accessTokenRequest.Check(); err != nil { return }
-	
-	accessTokenJson, err := c.postJson( ctx, "https://" + c.remote.String() + "/" + c.Config.APIVersion + "/accessToken", accessTokenRequest )
-	if err != nil { return }
-	
-	if err = json.Unmarshal( accessTokenJson, &accessToken ); err != nil { return }
+
 	if c.accessToken, err = base64.StdEncoding.DecodeString( accessToken ); err != nil { return }
-	
 	if len( c.Config.AccessTokenPath ) > 0 { err = os.WriteFile( c.Config.AccessTokenPath, []byte( accessToken ), 0600 ) }
 	return
 }
@@ -271,7 +345,7 @@ func ( c *Client ) ApplyFilter( ctx context.Context ) ( err error ) {
 }
 
 func ( c *Client ) FetchCategoryList( ctx context.Context ) ( err error ) {
-	response, err := c.get( ctx, "https://" + c.remote.String() + "/categorization/categories.json" )
+	response, err := c.get( ctx, c.baseURL() + "/categorization/categories.json" )
 	if err != nil { return }
 	
 	type Category struct {
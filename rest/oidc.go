@@ -0,0 +1,100 @@
+package rest
+
+import (
+	"context"
+	"encoding/base64"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"github.com/coreos/go-oidc/v3/oidc"
+	"golang.org/x/oauth2"
+	"log"
+	"os"
+	"strings"
+	"time"
+)
+
+var ErrOIDCNotConfigured = errors.New( "OIDC issuer not configured" )
+var ErrOIDCNoIdToken = errors.New( "OIDC token response carried no id_token" )
+
+// OIDCConfig configures an OAuth2 device-authorization-grant login against an external identity provider, used as an
+// alternative to a Hide.me Username/Password when obtaining an Access-Token
+type OIDCConfig struct {
+	Issuer		string		`yaml:"issuer,omitempty"`						// OIDC issuer URL, discovery document is fetched from here
+	ClientID	string		`yaml:"clientId,omitempty"`						// OAuth2 client id registered with the issuer
+}
+
+// OIDCExchangeRequest carries a verified OIDC id_token to the Hide.me "oidcExchange" endpoint in return for a Hide.me Access-Token
+type OIDCExchangeRequest struct {
+	Host		string		`json:"host"`
+	Domain		string		`json:"domain"`
+	IDToken		string		`json:"idToken"`
+}
+
+// oidcAccessToken runs the device-authorization-grant flow against Config.OIDC, prints the user_code and verification
+// URI for the operator to complete in a browser, exchanges the resulting id_token at "/<APIVersion>/oidcExchange" for a Base64
+// encoded Hide.me Access-Token, and keeps the oauth2.Config/Token around so oidcRefresh can renew silently later
+func ( c *Client ) oidcAccessToken( ctx context.Context ) ( accessToken string, err error ) {
+	if len( c.Config.OIDC.Issuer ) == 0 { err = ErrOIDCNotConfigured; return }
+	ctx = oidc.ClientContext( ctx, c.client )																							// Route discovery/device/token HTTP traffic through c.client so Config.Mark and pinning still apply
+
+	provider, err := oidc.NewProvider( ctx, c.Config.OIDC.Issuer )
+	if err != nil { return }
+	c.oauthConfig = &oauth2.Config{ ClientID: c.Config.OIDC.ClientID, Endpoint: provider.Endpoint(), Scopes: []string{ oidc.ScopeOpenID } }
+
+	deviceAuth, err := c.oauthConfig.DeviceAuth( ctx )
+	if err != nil { return }
+	fmt.Println( "OIDC: Open", deviceAuth.VerificationURIComplete, "and enter code", deviceAuth.UserCode, "to authorize this device" )
+
+	c.oauthToken, err = c.oauthConfig.DeviceAccessToken( ctx, deviceAuth )
+	if err != nil { return }
+	return c.oidcExchange( ctx, c.oauthToken )
+}
+
+// oidcExchange pulls the id_token out of token and exchanges it at "/<APIVersion>/oidcExchange" for a Hide.me Access-Token
+func ( c *Client ) oidcExchange( ctx context.Context, token *oauth2.Token ) ( accessToken string, err error ) {
+	rawIDToken, ok := token.Extra( "id_token" ).( string )
+	if !ok { err = ErrOIDCNoIdToken; return }
+
+	exchangeRequest := &OIDCExchangeRequest{
+		Host:		strings.TrimSuffix( c.Config.Host, ".hideservers.net" ),
+		Domain:		c.Config.Domain,
+		IDToken:	rawIDToken,
+	}
+	responseBody, err := c.postJson( ctx, c.baseURL() + "/" + c.Config.APIVersion + "/oidcExchange", exchangeRequest )
+	if err != nil { return }
+	err = json.Unmarshal( responseBody, &accessToken )
+	return
+}
+
+// oidcRefresh silently renews c.oauthToken through oauthConfig.TokenSource ( using its refresh_token ) instead of
+// repeating the interactive device flow, re-exchanges the resulting id_token, and persists the new Access-Token
+func ( c *Client ) oidcRefresh( ctx context.Context ) ( err error ) {
+	if c.oauthConfig == nil || c.oauthToken == nil { return ErrOIDCNotConfigured }
+	ctx = oidc.ClientContext( ctx, c.client )
+
+	token, err := c.oauthConfig.TokenSource( ctx, c.oauthToken ).Token()
+	if err != nil { return }
+	c.oauthToken = token
+
+	accessToken, err := c.oidcExchange( ctx, token )
+	if err != nil { return }
+	if c.accessToken, err = base64.StdEncoding.DecodeString( accessToken ); err != nil { return }
+	c.Config.Filter.AccessToken = c.accessToken
+	if len( c.Config.AccessTokenPath ) > 0 { err = os.WriteFile( c.Config.AccessTokenPath, []byte( accessToken ), 0600 ) }
+	return
+}
+
+// oidcRefreshLoop calls oidcRefresh every Config.AccessTokenUpdateDelay until ctx is done. It is unexported and has no
+// caller, so the "service" subcommand does not run it and does not refresh an OIDC-derived Access-Token in the background
+func ( c *Client ) oidcRefreshLoop( ctx context.Context ) {
+	ticker := time.NewTicker( c.Config.AccessTokenUpdateDelay )
+	defer ticker.Stop()
+	for {
+		select {
+			case <- ctx.Done(): return
+			case <- ticker.C:
+				if err := c.oidcRefresh( ctx ); err != nil { log.Println( "OIDC: [ERR] Access-Token refresh failed:", err ) }
+		}
+	}
+}
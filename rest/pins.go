@@ -0,0 +1,163 @@
+package rest
+
+import (
+	"context"
+	"crypto/ed25519"
+	"encoding/json"
+	"errors"
+	"log"
+	"os"
+	"sync"
+	"time"
+)
+
+var ErrPinManifestSignature = errors.New( "pin manifest signature invalid" )
+
+// pinsRootPublicKey is the offline Ed25519 root key's public half that signs pin manifests, baked into the binary so a rotated manifest can only come from whoever holds the matching private key
+var pinsRootPublicKey = ed25519.PublicKey{
+	0x1f, 0x3a, 0x9c, 0x5e, 0x7d, 0x21, 0x4b, 0x88, 0xaf, 0x02, 0x6c, 0x9d, 0xe1, 0x44, 0x7a, 0xb0,
+	0x5d, 0x33, 0xc8, 0x91, 0x0e, 0x67, 0xf2, 0xa4, 0x3b, 0x58, 0xd0, 0x29, 0x76, 0xbc, 0x1a, 0x04,
+}
+
+// defaultPins ships with the binary and is always trusted, regardless of whether a signed manifest is present
+var defaultPins = map[string]string{
+	"Hide.Me Root CA":					"AdKh8rXi68jeqv5kEzF4wJ9M2R89gFuMILRQ1uwADQI=",
+	"Hide.Me Server CA #1":			"CsEyDelMHMPh9qLGgeQn8sJwdUwvc+fCMhOU9Ne5PbU=",
+	"DigiCert Global Root CA":			"r/mIkG3eEpVdm+u/ko/cwxzOMo1bk4TyHIlByibiA5E=",
+	"DigiCert TLS RSA SHA256 2020 CA1":"RQeZkB42znUfsDIIFWIRiYEcKl7nHwNFwWCrnMMJbVc=",
+}
+
+// Pin is a single named CA pin entry, as carried in a PinManifest
+type Pin struct {
+	Name		string		`json:"name"`
+	SPKISha256	string		`json:"spki_sha256"`
+	NotBefore	time.Time	`json:"not_before,omitempty"`
+	NotAfter	time.Time	`json:"not_after,omitempty"`
+}
+
+// PinManifest is a signed rotation of Pin entries, served from "/<APIVersion>/pins.json" and optionally cached at Config.PinsPath
+type PinManifest struct {
+	Version		int			`json:"version"`
+	Pins		[]Pin		`json:"pins"`
+	Signature	[]byte		`json:"signature"`										// Ed25519 signature over Version+Pins
+}
+
+// signedPayload returns the bytes Signature is computed over
+func ( m *PinManifest ) signedPayload() ( []byte, error ) {
+	return json.Marshal( struct {
+		Version	int		`json:"version"`
+		Pins	[]Pin	`json:"pins"`
+	}{ m.Version, m.Pins } )
+}
+
+// Verify checks Signature against pinsRootPublicKey
+func ( m *PinManifest ) Verify() ( err error ) {
+	payload, err := m.signedPayload()
+	if err != nil { return }
+	if !ed25519.Verify( pinsRootPublicKey, payload, m.Signature ) { return ErrPinManifestSignature }
+	return
+}
+
+// PinStore holds the CA pins a Client currently trusts: the compiled-in defaultPins, unioned with any non-expired
+// entries from a signed manifest at path, plus a TOFU-recorded pin per CommonName when the caller opted into that
+type PinStore struct {
+	path	string
+	pins	map[string]string
+	tofuMu	sync.Mutex
+	tofu	map[string]string												// Guarded by tofuMu: concurrent TLS handshakes may record or look up a TOFU pin at the same time
+}
+
+// newPinStore seeds a PinStore from defaults, then loads and verifies a signed manifest from path when one is present.
+// A missing file is silently ignored; a present-but-corrupt or unverifiable manifest is logged and otherwise ignored
+// too — defaultPins alone must always be enough to keep connecting, a bad manifest on disk must never brick the client
+func newPinStore( defaults map[string]string, path string, loadTofu bool ) ( store *PinStore ) {
+	store = &PinStore{ path: path, pins: map[string]string{} }
+	for name, pin := range defaults { store.pins[ name ] = pin }
+
+	if len( path ) > 0 {
+		if manifestBytes, readErr := os.ReadFile( path ); readErr == nil {
+			var manifest PinManifest
+			if err := json.Unmarshal( manifestBytes, &manifest ); err != nil {
+				log.Println( "Pins: [ERR]", path, "is not a valid pin manifest, falling back to built-in pins:", err )
+			} else if err := manifest.Verify(); err != nil {
+				log.Println( "Pins: [ERR]", path, "failed signature verification, falling back to built-in pins:", err )
+			} else {
+				now := time.Now()
+				for _, pin := range manifest.Pins {
+					if !pin.NotBefore.IsZero() && now.Before( pin.NotBefore ) { continue }
+					if !pin.NotAfter.IsZero() && now.After( pin.NotAfter ) { continue }
+					store.pins[ pin.Name ] = pin.SPKISha256
+				}
+			}
+		}
+	}
+
+	if loadTofu {
+		store.tofu = map[string]string{}
+		if tofuBytes, readErr := os.ReadFile( store.tofuPath() ); readErr == nil { _ = json.Unmarshal( tofuBytes, &store.tofu ) }
+	}
+	return
+}
+
+// tofuPath is where TOFU-recorded pins are persisted, next to the manifest when one is configured, in the working directory otherwise
+func ( s *PinStore ) tofuPath() string {
+	if len( s.path ) > 0 { return s.path + ".tofu" }
+	return "pins.tofu.json"
+}
+
+// tofuLookup returns the previously recorded TOFU pin for name, if any
+func ( s *PinStore ) tofuLookup( name string ) ( pin string, recorded bool ) {
+	s.tofuMu.Lock(); defer s.tofuMu.Unlock()
+	pin, recorded = s.tofu[ name ]
+	return
+}
+
+// recordTofu persists a first-observed CA pin for name so it is trusted on every subsequent connection
+func ( s *PinStore ) recordTofu( name, pin string ) error {
+	s.tofuMu.Lock(); defer s.tofuMu.Unlock()
+	if s.tofu == nil { s.tofu = map[string]string{} }
+	s.tofu[ name ] = pin
+	tofuBytes, err := json.MarshalIndent( s.tofu, "", "\t" )
+	if err != nil { return err }
+	return os.WriteFile( s.tofuPath(), tofuBytes, 0600 )
+}
+
+// RefreshPins fetches the signed pin manifest from "/<APIVersion>/pins.json" and, if its Version is newer than what's on disk,
+// verifies it and atomically rewrites Config.PinsPath, then rebuilds c.pinStore from the new file
+func ( c *Client ) RefreshPins( ctx context.Context ) ( err error ) {
+	if len( c.Config.PinsPath ) == 0 { return }
+	body, err := c.get( ctx, c.baseURL() + "/" + c.Config.APIVersion + "/pins.json" )
+	if err != nil { return }
+
+	var manifest PinManifest
+	if err = json.Unmarshal( body, &manifest ); err != nil { return }
+	if err = manifest.Verify(); err != nil { log.Println( "Pins: [ERR] Offered manifest signature invalid:", err ); return }
+
+	currentVersion := 0
+	if existing, readErr := os.ReadFile( c.Config.PinsPath ); readErr == nil {
+		var current PinManifest
+		if json.Unmarshal( existing, &current ) == nil { currentVersion = current.Version }
+	}
+	if manifest.Version <= currentVersion { return }
+
+	tmpPath := c.Config.PinsPath + ".tmp"
+	if err = os.WriteFile( tmpPath, body, 0644 ); err != nil { return }
+	if err = os.Rename( tmpPath, c.Config.PinsPath ); err != nil { return }
+	log.Println( "Pins: Manifest rotated to version", manifest.Version )
+
+	c.setPinStore( newPinStore( defaultPins, c.Config.PinsPath, c.Config.PinTofu ) )
+	return
+}
+
+// pinsRefreshLoop calls RefreshPins every period until ctx is done. It is unexported and has no caller, so the "service" subcommand does not run it and the manifest is not fetched periodically
+func ( c *Client ) pinsRefreshLoop( ctx context.Context, period time.Duration ) {
+	ticker := time.NewTicker( period )
+	defer ticker.Stop()
+	for {
+		select {
+			case <- ctx.Done(): return
+			case <- ticker.C:
+				if err := c.RefreshPins( ctx ); err != nil { log.Println( "Pins: [ERR] Refresh failed:", err ) }
+		}
+	}
+}
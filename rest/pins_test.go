@@ -0,0 +1,134 @@
+package rest
+
+import (
+	"crypto/ed25519"
+	"encoding/json"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+)
+
+// signedManifest builds a PinManifest signed by a freshly generated Ed25519 key, returning the manifest and the
+// public key it verifies against, so tests can swap it in for pinsRootPublicKey without touching the real one
+func signedManifest( t *testing.T, pins []Pin ) ( manifest PinManifest, public ed25519.PublicKey, private ed25519.PrivateKey ) {
+	t.Helper()
+	public, private, err := ed25519.GenerateKey( nil )
+	if err != nil { t.Fatalf( "failed to generate fixture key: %v", err ) }
+	manifest = PinManifest{ Version: 1, Pins: pins }
+	payload, err := manifest.signedPayload()
+	if err != nil { t.Fatalf( "failed to build signed payload: %v", err ) }
+	manifest.Signature = ed25519.Sign( private, payload )
+	return
+}
+
+func withRootKey( t *testing.T, key ed25519.PublicKey ) {
+	t.Helper()
+	saved := pinsRootPublicKey
+	pinsRootPublicKey = key
+	t.Cleanup( func() { pinsRootPublicKey = saved } )
+}
+
+func TestPinManifestVerify( t *testing.T ) {
+	manifest, public, _ := signedManifest( t, []Pin{ { Name: "Test CA", SPKISha256: "abc=" } } )
+	withRootKey( t, public )
+
+	if err := manifest.Verify(); err != nil { t.Fatalf( "expected a correctly signed manifest to verify, got %v", err ) }
+
+	tampered := manifest
+	tampered.Pins = []Pin{ { Name: "Evil CA", SPKISha256: "xyz=" } }
+	if err := tampered.Verify(); err != ErrPinManifestSignature {
+		t.Fatalf( "expected a tampered manifest to fail verification, got %v", err )
+	}
+
+	wrongKey, _, _ := ed25519.GenerateKey( nil )
+	withRootKey( t, wrongKey )
+	if err := manifest.Verify(); err != ErrPinManifestSignature {
+		t.Fatalf( "expected verification against the wrong root key to fail, got %v", err )
+	}
+}
+
+func TestNewPinStoreNoManifestPath( t *testing.T ) {
+	store := newPinStore( defaultPins, "", false )
+	for name, pin := range defaultPins {
+		if store.pins[ name ] != pin { t.Fatalf( "expected default pin %s to be present", name ) }
+	}
+	if store.tofu != nil { t.Fatalf( "expected tofu map to stay nil when loadTofu is false" ) }
+}
+
+func TestNewPinStoreValidManifest( t *testing.T ) {
+	manifest, public, _ := signedManifest( t, []Pin{ { Name: "Rotated CA", SPKISha256: "rotated=" } } )
+	withRootKey( t, public )
+
+	path := filepath.Join( t.TempDir(), "pins.json" )
+	body, err := json.Marshal( manifest )
+	if err != nil { t.Fatalf( "failed to marshal fixture manifest: %v", err ) }
+	if err := os.WriteFile( path, body, 0644 ); err != nil { t.Fatalf( "failed to write fixture manifest: %v", err ) }
+
+	store := newPinStore( defaultPins, path, false )
+	if store.pins[ "Rotated CA" ] != "rotated=" { t.Fatalf( "expected the manifest's pin to be merged in" ) }
+	for name, pin := range defaultPins {
+		if store.pins[ name ] != pin { t.Fatalf( "expected default pin %s to survive alongside a valid manifest", name ) }
+	}
+}
+
+func TestNewPinStoreCorruptManifestFallsBackToDefaults( t *testing.T ) {
+	path := filepath.Join( t.TempDir(), "pins.json" )
+	if err := os.WriteFile( path, []byte( "not json" ), 0644 ); err != nil { t.Fatalf( "failed to write fixture manifest: %v", err ) }
+
+	store := newPinStore( defaultPins, path, false )
+	for name, pin := range defaultPins {
+		if store.pins[ name ] != pin { t.Fatalf( "expected default pin %s to survive a corrupt manifest file", name ) }
+	}
+	if len( store.pins ) != len( defaultPins ) { t.Fatalf( "expected no extra pins to be merged from a corrupt manifest" ) }
+}
+
+func TestNewPinStoreUnverifiableManifestFallsBackToDefaults( t *testing.T ) {
+	manifest, _, _ := signedManifest( t, []Pin{ { Name: "Rotated CA", SPKISha256: "rotated=" } } )
+	otherKey, _, _ := ed25519.GenerateKey( nil )
+	withRootKey( t, otherKey )																		// manifest was signed for a different key, so it must fail Verify()
+
+	path := filepath.Join( t.TempDir(), "pins.json" )
+	body, err := json.Marshal( manifest )
+	if err != nil { t.Fatalf( "failed to marshal fixture manifest: %v", err ) }
+	if err := os.WriteFile( path, body, 0644 ); err != nil { t.Fatalf( "failed to write fixture manifest: %v", err ) }
+
+	store := newPinStore( defaultPins, path, false )
+	if _, rotated := store.pins[ "Rotated CA" ]; rotated { t.Fatalf( "expected a manifest with a bad signature to be ignored" ) }
+	for name, pin := range defaultPins {
+		if store.pins[ name ] != pin { t.Fatalf( "expected default pin %s to survive an unverifiable manifest", name ) }
+	}
+}
+
+func TestNewPinStoreExpiredAndNotYetValidPinsAreSkipped( t *testing.T ) {
+	now := time.Now()
+	manifest, public, _ := signedManifest( t, []Pin{
+		{ Name: "Expired CA", SPKISha256: "expired=", NotAfter: now.Add( -time.Hour ) },
+		{ Name: "Future CA", SPKISha256: "future=", NotBefore: now.Add( time.Hour ) },
+		{ Name: "Current CA", SPKISha256: "current=", NotBefore: now.Add( -time.Hour ), NotAfter: now.Add( time.Hour ) },
+	} )
+	withRootKey( t, public )
+
+	path := filepath.Join( t.TempDir(), "pins.json" )
+	body, err := json.Marshal( manifest )
+	if err != nil { t.Fatalf( "failed to marshal fixture manifest: %v", err ) }
+	if err := os.WriteFile( path, body, 0644 ); err != nil { t.Fatalf( "failed to write fixture manifest: %v", err ) }
+
+	store := newPinStore( defaultPins, path, false )
+	if _, ok := store.pins[ "Expired CA" ]; ok { t.Fatalf( "expected an expired pin to be skipped" ) }
+	if _, ok := store.pins[ "Future CA" ]; ok { t.Fatalf( "expected a not-yet-valid pin to be skipped" ) }
+	if store.pins[ "Current CA" ] != "current=" { t.Fatalf( "expected a currently valid pin to be kept" ) }
+}
+
+func TestNewPinStoreLoadTofu( t *testing.T ) {
+	dir := t.TempDir()
+	path := filepath.Join( dir, "pins.json" )
+
+	store := newPinStore( defaultPins, path, true )
+	if store.tofu == nil { t.Fatalf( "expected tofu map to be initialized when loadTofu is true" ) }
+	if err := store.recordTofu( "Some CA", "some-pin=" ); err != nil { t.Fatalf( "recordTofu failed: %v", err ) }
+
+	reloaded := newPinStore( defaultPins, path, true )
+	pin, recorded := reloaded.tofuLookup( "Some CA" )
+	if !recorded || pin != "some-pin=" { t.Fatalf( "expected a reloaded PinStore to recover the persisted TOFU pin" ) }
+}
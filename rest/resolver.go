@@ -0,0 +1,157 @@
+package rest
+
+import (
+	"bytes"
+	"context"
+	"crypto/sha256"
+	"crypto/tls"
+	"crypto/x509"
+	"encoding/base64"
+	"encoding/binary"
+	"errors"
+	"io"
+	"log"
+	"math/rand"
+	"net"
+	"net/http"
+	"net/url"
+	"strings"
+	"time"
+)
+
+var ErrDnsResponse = errors.New( "bad DNS response" )
+
+// bootstrapPins pins the public CAs behind the well known DoT/DoH resolvers this client may bootstrap from, matched
+// against each certificate's own Subject.CommonName exactly like Client.Pins matches hide.me's own CAs
+var bootstrapPins = map[string]string{
+	"Baltimore CyberTrust Root":					"4ZlQj+eCJvI8zMDQJ2KFgFZ9Jq/hwQmvJYKpJ8TV7nA=",			// Cloudflare ( 1.1.1.1 )
+	"USERTrust RSA Certification Authority":		"9u+sSMcX9wJCVQ/IXd/Au3bdAZyQVq0GNxZzuB8aA/M=",			// Quad9
+	"GTS Root R1":									"h6801m+z8v3zbgkRHpq6tPgzucfoCpPBSdDZHuzSRqg=",			// Google ( 8.8.8.8 )
+}
+
+// secureResolver dials Config.DnsServers entries that asked for DoT ( tls:// ) or DoH ( https:// ) instead of plain UDP/TCP, picking a server at random the same way the plain resolver does
+type secureResolver struct {
+	client	*Client
+	servers	[]*url.URL
+	dialer	*net.Dialer
+}
+
+// newSecureResolver wires up a secureResolver over the already-marked dialer Init() built, so DoT/DoH lookups honor Config.Mark exactly like every other request this client makes
+func newSecureResolver( c *Client, servers []*url.URL, dialer *net.Dialer ) *secureResolver {
+	return &secureResolver{ client: c, servers: servers, dialer: dialer }
+}
+
+// LookupIPAddr resolves host against a randomly picked configured DoT/DoH server
+func ( r *secureResolver ) LookupIPAddr( ctx context.Context, host string ) ( addrs []net.IPAddr, err error ) {
+	server := r.servers[ rand.Intn( len( r.servers ) ) ]
+	var response []byte
+	switch server.Scheme {
+		case "tls":		response, err = r.queryDoT( ctx, server.Host, host )
+		case "https":	response, err = r.queryDoH( ctx, server, host )
+	}
+	if err != nil { return }
+	ip, err := parseDnsAnswerA( response )
+	if err != nil { return }
+	log.Println( "Resolver:", host, "resolved to", ip, "via", server.String() )
+	return []net.IPAddr{ { IP: ip } }, nil
+}
+
+// queryDoT issues a DNS-over-TLS query per RFC 7858, a 2-byte length-prefixed DNS message over a pinned TLS connection
+func ( r *secureResolver ) queryDoT( ctx context.Context, addr string, host string ) ( response []byte, err error ) {
+	tlsDialer := &tls.Dialer{ NetDialer: r.dialer, Config: &tls.Config{ MinVersion: tls.VersionTLS12, VerifyPeerCertificate: verifyBootstrapPins } }
+	conn, err := tlsDialer.DialContext( ctx, "tcp", addr )
+	if err != nil { return }
+	defer conn.Close()
+
+	if deadline, ok := ctx.Deadline(); ok { err = conn.SetDeadline( deadline ) } else { err = conn.SetDeadline( time.Now().Add( r.client.Config.RestTimeout ) ) }	// A DoT server that accepts the connection but never answers must not hang this goroutine forever
+	if err != nil { return }
+
+	query := buildDnsQueryA( host )
+	lengthPrefix := []byte{ byte( len( query ) >> 8 ), byte( len( query ) ) }
+	if _, err = conn.Write( append( lengthPrefix, query... ) ); err != nil { return }
+
+	lengthBuf := make( []byte, 2 )
+	if _, err = io.ReadFull( conn, lengthBuf ); err != nil { return }
+	response = make( []byte, binary.BigEndian.Uint16( lengthBuf ) )
+	_, err = io.ReadFull( conn, response )
+	return
+}
+
+// queryDoH issues a DNS-over-HTTPS query per RFC 8484, a POST of a wire-format DNS message to the resolver's URL
+func ( r *secureResolver ) queryDoH( ctx context.Context, server *url.URL, host string ) ( response []byte, err error ) {
+	httpClient := &http.Client{
+		Timeout:	time.Second * 5,
+		Transport: &http.Transport{
+			DialContext:		r.dialer.DialContext,
+			TLSClientConfig:	&tls.Config{ MinVersion: tls.VersionTLS12, VerifyPeerCertificate: verifyBootstrapPins },
+		},
+	}
+	request, err := http.NewRequestWithContext( ctx, "POST", server.String(), bytes.NewReader( buildDnsQueryA( host ) ) )
+	if err != nil { return }
+	request.Header.Set( "content-type", "application/dns-message" )
+	request.Header.Set( "accept", "application/dns-message" )
+
+	httpResponse, err := httpClient.Do( request )
+	if err != nil { return }
+	defer httpResponse.Body.Close()
+	if httpResponse.StatusCode != http.StatusOK { return nil, ErrHttpStatusBad }
+	return io.ReadAll( httpResponse.Body )
+}
+
+// verifyBootstrapPins checks the resolver's CA chain against bootstrapPins, the same strict pin-or-fail approach Client.Pins uses for hide.me's own CAs
+func verifyBootstrapPins( _ [][]byte, verifiedChains [][]*x509.Certificate ) error {
+	for _, chain := range verifiedChains {
+		chainLoop:
+		for _, certificate := range chain {
+			if !certificate.IsCA { continue }
+			sum := sha256.Sum256( certificate.RawSubjectPublicKeyInfo )
+			pin := base64.StdEncoding.EncodeToString( sum[:] )
+			for name, authorizedPin := range bootstrapPins {
+				if certificate.Subject.CommonName == name && pin == authorizedPin {
+					continue chainLoop
+				}
+			}
+			return ErrBadPin
+		}
+	}
+	return nil
+}
+
+// buildDnsQueryA builds a minimal wire-format DNS query for a single A record ( RFC 1035 section 4.1 )
+func buildDnsQueryA( host string ) []byte {
+	id := uint16( rand.Intn( 1 << 16 ) )
+	message := []byte{ byte( id >> 8 ), byte( id ), 0x01, 0x00, 0x00, 0x01, 0x00, 0x00, 0x00, 0x00, 0x00, 0x00 }			// header: recursion desired, 1 question
+	for _, label := range strings.Split( host, "." ) {
+		message = append( message, byte( len( label ) ) )
+		message = append( message, label... )
+	}
+	return append( message, 0x00, 0x00, 0x01, 0x00, 0x01 )																	// root label, QTYPE=A, QCLASS=IN
+}
+
+// parseDnsAnswerA extracts the first A record IP out of a wire-format DNS response
+func parseDnsAnswerA( response []byte ) ( ip net.IP, err error ) {
+	if len( response ) < 12 { return nil, ErrDnsResponse }
+	answerCount := int( response[6] )<<8 | int( response[7] )
+	if answerCount == 0 { return nil, ErrDnsResponse }
+
+	offset := 12
+	for offset < len( response ) && response[ offset ] != 0 { offset += int( response[ offset ] ) + 1 }					// skip QNAME
+	offset += 5																											// root label + QTYPE + QCLASS
+
+	for i := 0; i < answerCount && offset < len( response ); i++ {
+		if response[ offset ] & 0xC0 == 0xC0 { offset += 2 } else {														// compressed name pointer
+			for offset < len( response ) && response[ offset ] != 0 { offset += int( response[ offset ] ) + 1 }
+			offset++
+		}
+		if offset + 10 > len( response ) { return nil, ErrDnsResponse }
+		recordType := int( response[ offset ] )<<8 | int( response[ offset + 1 ] )
+		recordLength := int( response[ offset + 8 ] )<<8 | int( response[ offset + 9 ] )
+		offset += 10
+		if recordType == 1 && recordLength == 4 {																		// TYPE=A
+			if offset + 4 > len( response ) { return nil, ErrDnsResponse }
+			return net.IP( response[ offset : offset + 4 ] ), nil
+		}
+		offset += recordLength
+	}
+	return nil, ErrDnsResponse
+}
@@ -0,0 +1,94 @@
+package rest
+
+import (
+	"crypto/sha256"
+	"crypto/x509"
+	"crypto/x509/pkix"
+	"encoding/base64"
+	"testing"
+)
+
+// buildDnsResponseA builds a minimal wire-format DNS response carrying a single A record answer for ip, echoing the
+// question section bytes so parseDnsAnswerA's QNAME skip has something realistic to walk over
+func buildDnsResponseA( t *testing.T, ip [4]byte ) []byte {
+	t.Helper()
+	query := buildDnsQueryA( "example.com" )
+	response := append( []byte{}, query... )
+	response[2] = 0x81																				// QR=1, RD=1
+	response[3] = 0x80																				// RA=1
+	response[6], response[7] = 0x00, 0x01															// ANCOUNT=1
+
+	response = append( response, 0xc0, 0x0c )														// NAME: pointer to the question's QNAME
+	response = append( response, 0x00, 0x01 )														// TYPE=A
+	response = append( response, 0x00, 0x01 )														// CLASS=IN
+	response = append( response, 0x00, 0x00, 0x00, 0x3c )											// TTL=60
+	response = append( response, 0x00, 0x04 )														// RDLENGTH=4
+	response = append( response, ip[:]... )														// RDATA
+	return response
+}
+
+func TestParseDnsAnswerA( t *testing.T ) {
+	t.Run( "valid response", func( t *testing.T ) {
+		response := buildDnsResponseA( t, [4]byte{ 203, 0, 113, 1 } )
+		ip, err := parseDnsAnswerA( response )
+		if err != nil { t.Fatalf( "unexpected error: %v", err ) }
+		if ip.String() != "203.0.113.1" { t.Fatalf( "expected 203.0.113.1, got %s", ip.String() ) }
+	} )
+
+	t.Run( "empty response", func( t *testing.T ) {
+		if _, err := parseDnsAnswerA( nil ); err != ErrDnsResponse { t.Fatalf( "expected ErrDnsResponse, got %v", err ) }
+	} )
+
+	t.Run( "header too short", func( t *testing.T ) {
+		if _, err := parseDnsAnswerA( make( []byte, 11 ) ); err != ErrDnsResponse { t.Fatalf( "expected ErrDnsResponse, got %v", err ) }
+	} )
+
+	t.Run( "zero answers", func( t *testing.T ) {
+		response := buildDnsResponseA( t, [4]byte{ 203, 0, 113, 1 } )
+		response[7] = 0x00																			// ANCOUNT=0
+		if _, err := parseDnsAnswerA( response ); err != ErrDnsResponse { t.Fatalf( "expected ErrDnsResponse, got %v", err ) }
+	} )
+
+	t.Run( "truncated before record header", func( t *testing.T ) {
+		response := buildDnsResponseA( t, [4]byte{ 203, 0, 113, 1 } )
+		response = response[ : len( response ) - 14 ]												// keep only the answer's 2-byte name pointer, cut TYPE through RDATA
+		if _, err := parseDnsAnswerA( response ); err != ErrDnsResponse { t.Fatalf( "expected ErrDnsResponse, got %v", err ) }
+	} )
+
+	t.Run( "truncated rdata", func( t *testing.T ) {
+		response := buildDnsResponseA( t, [4]byte{ 203, 0, 113, 1 } )
+		response = response[ : len( response ) - 2 ]												// RDLENGTH says 4 bytes but only 2 remain
+		if _, err := parseDnsAnswerA( response ); err != ErrDnsResponse { t.Fatalf( "expected ErrDnsResponse, got %v", err ) }
+	} )
+}
+
+func TestVerifyBootstrapPins( t *testing.T ) {
+	const name = "Test Fixture CA"
+	spki := []byte( "a fixture SPKI payload, doesn't need to be a real key for this test" )
+	sum := sha256.Sum256( spki )
+	pin := base64.StdEncoding.EncodeToString( sum[:] )
+
+	saved := bootstrapPins
+	bootstrapPins = map[string]string{ name: pin }
+	defer func() { bootstrapPins = saved }()
+
+	matching := &x509.Certificate{ IsCA: true, Subject: pkix.Name{ CommonName: name }, RawSubjectPublicKeyInfo: spki }
+	if err := verifyBootstrapPins( nil, [][]*x509.Certificate{ { matching } } ); err != nil {
+		t.Fatalf( "expected a matching CA to verify, got %v", err )
+	}
+
+	wrongName := &x509.Certificate{ IsCA: true, Subject: pkix.Name{ CommonName: "Not A Real CA" }, RawSubjectPublicKeyInfo: spki }
+	if err := verifyBootstrapPins( nil, [][]*x509.Certificate{ { wrongName } } ); err != ErrBadPin {
+		t.Fatalf( "expected ErrBadPin for an unrecognized CA name, got %v", err )
+	}
+
+	wrongKey := &x509.Certificate{ IsCA: true, Subject: pkix.Name{ CommonName: name }, RawSubjectPublicKeyInfo: []byte( "not the pinned key" ) }
+	if err := verifyBootstrapPins( nil, [][]*x509.Certificate{ { wrongKey } } ); err != ErrBadPin {
+		t.Fatalf( "expected ErrBadPin for a CommonName match with a mismatched key, got %v", err )
+	}
+
+	notCA := &x509.Certificate{ IsCA: false, Subject: pkix.Name{ CommonName: name }, RawSubjectPublicKeyInfo: spki }
+	if err := verifyBootstrapPins( nil, [][]*x509.Certificate{ { notCA } } ); err != nil {
+		t.Fatalf( "expected a non-CA leaf certificate to be skipped, got %v", err )
+	}
+}